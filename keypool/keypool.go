@@ -0,0 +1,215 @@
+// Package keypool implements round-robin selection and health tracking for a
+// pool of upstream API keys, so the proxy can spread load across several
+// OpenAI keys while hiding the pool from callers.
+package keypool
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrExhausted is returned by callers of Next (via their own checks) when a
+// configured pool has every key on cooldown.
+var ErrExhausted = errors.New("keypool: all keys are on cooldown")
+
+// keyState tracks the health of a single key.
+type keyState struct {
+	key string
+
+	mu             sync.Mutex
+	consecutive401 int
+	consecutive429 int
+	consecutive5xx int
+	cooldownUntil  time.Time
+	lastUsed       time.Time
+	totalRequests  int64
+	totalFailures  int64
+}
+
+// Pool is a round-robin set of API keys with per-key cooldowns. It is safe
+// for concurrent use.
+type Pool struct {
+	mu   sync.Mutex
+	keys []*keyState
+	next int
+}
+
+// New creates a Pool from a list of raw key strings. Empty entries are
+// ignored so callers can pass the result of splitting an env var without
+// pre-trimming it.
+func New(rawKeys []string) *Pool {
+	p := &Pool{}
+	for _, k := range rawKeys {
+		k = strings.TrimSpace(k)
+		if k == "" {
+			continue
+		}
+		p.keys = append(p.keys, &keyState{key: k})
+	}
+	return p
+}
+
+// ParseKeys splits an OPENAI_API_KEYS-style value ("sk-a|sk-b|sk-c") into
+// individual keys.
+func ParseKeys(raw string) []string {
+	if raw == "" {
+		return nil
+	}
+	return strings.Split(raw, "|")
+}
+
+// Len reports how many keys are configured.
+func (p *Pool) Len() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.keys)
+}
+
+// Next returns the next key to use in round-robin order, skipping any key
+// that is currently in cooldown. It returns ok=false if every key is on
+// cooldown or the pool is empty.
+func (p *Pool) Next() (key string, ok bool) {
+	if p == nil || len(p.keys) == 0 {
+		return "", false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for i := 0; i < len(p.keys); i++ {
+		idx := (p.next + i) % len(p.keys)
+		ks := p.keys[idx]
+
+		ks.mu.Lock()
+		onCooldown := ks.cooldownUntil.After(now)
+		if !onCooldown {
+			ks.lastUsed = now
+			ks.totalRequests++
+		}
+		k := ks.key
+		ks.mu.Unlock()
+
+		if onCooldown {
+			continue
+		}
+
+		p.next = (idx + 1) % len(p.keys)
+		return k, true
+	}
+
+	return "", false
+}
+
+// RecordResult updates a key's health counters from the upstream response
+// status. retryAfter, when non-zero, is honored as the cooldown duration for
+// a 429; otherwise a default backoff is used.
+func (p *Pool) RecordResult(key string, statusCode int, retryAfter time.Duration) {
+	if p == nil {
+		return
+	}
+
+	ks := p.find(key)
+	if ks == nil {
+		return
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	switch {
+	case statusCode == 401:
+		ks.consecutive401++
+		ks.consecutive429 = 0
+		ks.consecutive5xx = 0
+		ks.totalFailures++
+	case statusCode == 429:
+		ks.consecutive429++
+		ks.consecutive401 = 0
+		ks.consecutive5xx = 0
+		ks.totalFailures++
+		cooldown := retryAfter
+		if cooldown <= 0 {
+			cooldown = 30 * time.Second
+		}
+		ks.cooldownUntil = time.Now().Add(cooldown)
+	case statusCode >= 500:
+		ks.consecutive5xx++
+		ks.consecutive401 = 0
+		ks.consecutive429 = 0
+		ks.totalFailures++
+		ks.cooldownUntil = time.Now().Add(5 * time.Second)
+	default:
+		ks.consecutive401 = 0
+		ks.consecutive429 = 0
+		ks.consecutive5xx = 0
+	}
+}
+
+func (p *Pool) find(key string) *keyState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, ks := range p.keys {
+		if ks.key == key {
+			return ks
+		}
+	}
+	return nil
+}
+
+// Status is a JSON-serializable snapshot of one key's health, with the key
+// itself masked so it is safe to expose over /debug/keys.
+type Status struct {
+	Key            string    `json:"key"`
+	Consecutive401 int       `json:"consecutive_401"`
+	Consecutive429 int       `json:"consecutive_429"`
+	Consecutive5xx int       `json:"consecutive_5xx"`
+	OnCooldown     bool      `json:"on_cooldown"`
+	CooldownUntil  time.Time `json:"cooldown_until,omitempty"`
+	LastUsed       time.Time `json:"last_used,omitempty"`
+	TotalRequests  int64     `json:"total_requests"`
+	TotalFailures  int64     `json:"total_failures"`
+}
+
+// Statuses returns a snapshot of every key's health, in pool order.
+func (p *Pool) Statuses() []Status {
+	if p == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	keys := make([]*keyState, len(p.keys))
+	copy(keys, p.keys)
+	p.mu.Unlock()
+
+	now := time.Now()
+	out := make([]Status, 0, len(keys))
+	for _, ks := range keys {
+		ks.mu.Lock()
+		out = append(out, Status{
+			Key:            maskKey(ks.key),
+			Consecutive401: ks.consecutive401,
+			Consecutive429: ks.consecutive429,
+			Consecutive5xx: ks.consecutive5xx,
+			OnCooldown:     ks.cooldownUntil.After(now),
+			CooldownUntil:  ks.cooldownUntil,
+			LastUsed:       ks.lastUsed,
+			TotalRequests:  ks.totalRequests,
+			TotalFailures:  ks.totalFailures,
+		})
+		ks.mu.Unlock()
+	}
+	return out
+}
+
+// maskKey redacts all but the last 4 characters of a key so it can be
+// logged or exposed over the debug endpoint without leaking credentials.
+func maskKey(key string) string {
+	if len(key) <= 4 {
+		return "****"
+	}
+	return strings.Repeat("*", len(key)-4) + key[len(key)-4:]
+}
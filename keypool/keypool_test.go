@@ -0,0 +1,44 @@
+package keypool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextSkipsCooldownAndReportsExhaustion(t *testing.T) {
+	p := New([]string{"sk-a", "sk-b"})
+
+	key, ok := p.Next()
+	if !ok || key != "sk-a" {
+		t.Fatalf("Next() = (%q, %v), want (sk-a, true)", key, ok)
+	}
+
+	p.RecordResult("sk-a", 429, 0)
+
+	// sk-a is on cooldown, so round-robin should skip it.
+	key, ok = p.Next()
+	if !ok || key != "sk-b" {
+		t.Fatalf("Next() = (%q, %v), want (sk-b, true)", key, ok)
+	}
+
+	p.RecordResult("sk-b", 429, time.Minute)
+
+	if _, ok := p.Next(); ok {
+		t.Fatal("expected Next() to report exhaustion when every key is on cooldown")
+	}
+}
+
+func TestRecordResultClearsCountersOnSuccess(t *testing.T) {
+	p := New([]string{"sk-a"})
+
+	p.RecordResult("sk-a", 401, 0)
+	p.RecordResult("sk-a", 200, 0)
+
+	statuses := p.Statuses()
+	if len(statuses) != 1 {
+		t.Fatalf("expected 1 status, got %d", len(statuses))
+	}
+	if statuses[0].Consecutive401 != 0 {
+		t.Errorf("Consecutive401 = %d, want 0 after a successful request", statuses[0].Consecutive401)
+	}
+}
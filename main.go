@@ -3,32 +3,87 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/subtle"
 	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
+
+	"github.com/fhyx/openai-proxy/keypool"
+	"github.com/fhyx/openai-proxy/middleware"
+	"github.com/fhyx/openai-proxy/mitm"
+	"github.com/fhyx/openai-proxy/ratelimit"
+	"github.com/fhyx/openai-proxy/respcache"
+	"github.com/fhyx/openai-proxy/router"
 )
 
 // Config holds the application configuration
 type Config struct {
-	Target    string // 目标域名
-	Listen    string // 监听端口
-	LocalEnv  bool   // 是否本地环境
-	HttpProxy string // 本地代理地址和端口
+	Target           string        // 目标域名，在未配置RoutesFile时作为默认路由的上游
+	Listen           string        // 监听端口
+	LocalEnv         bool          // 是否本地环境
+	HttpProxy        string        // 本地代理地址和端口
+	OpenAIKeys       []string      // 上游OpenAI API Key池，轮询使用
+	RoutesFile       string        // 路由表配置文件路径（YAML或JSON），为空时使用Target构建默认路由
+	AdminToken       string        // /admin/routes 和 /admin/limits 接口的Bearer鉴权token，为空时禁用这些接口
+	CACertFile       string        // MITM根证书路径，与CAKeyFile同时配置时启用CONNECT拦截
+	CAKeyFile        string        // MITM根证书私钥路径
+	RPS              float64       // 全局每秒请求数限制，<=0表示不限制
+	Burst            int           // 全局限流的突发容量
+	PerKeyRPS        float64       // 按调用方Authorization头限流的每秒请求数，<=0表示不限制
+	PerIPConcurrency int           // 按客户端IP限制的并发请求数，<=0表示不限制
+	CacheTTL         time.Duration // 幂等接口响应缓存的TTL，<=0表示禁用缓存
+	CacheMaxEntries  int           // 内存缓存的最大条目数，<=0表示不限制
 }
 
 // Proxy represents the HTTP proxy server
 type Proxy struct {
-	config     Config
-	httpClient *http.Client
-	logger     *log.Logger
+	config         Config
+	httpClient     *http.Client
+	logger         *log.Logger
+	keyPool        *keypool.Pool
+	routes         *router.Table
+	middlewares    middleware.Chain
+	certCache      *mitm.CertCache
+	globalLimiter  *ratelimit.Limiter
+	perKeyLimiters *ratelimit.KeyedLimiters
+	perIPSem       *ratelimit.Semaphore
+	respCache      respcache.Backend
+
+	// configMu guards the rate-limit fields of config (RPS, Burst,
+	// PerKeyRPS, PerIPConcurrency) and perIPSem: /admin/limits rewrites
+	// them at runtime while request handling reads them concurrently.
+	configMu sync.RWMutex
+}
+
+// getConfig returns a copy of the current config, safe to read without
+// racing a concurrent /admin/limits update.
+func (p *Proxy) getConfig() Config {
+	p.configMu.RLock()
+	defer p.configMu.RUnlock()
+	return p.config
+}
+
+// Use registers a middleware to run on every proxied request and response,
+// in the order it was added.
+func (p *Proxy) Use(m middleware.Middleware) {
+	p.middlewares = append(p.middlewares, m)
 }
 
 // NewProxy creates a new proxy instance with the given configuration
@@ -54,17 +109,111 @@ func NewProxy(config Config) *Proxy {
 		// 代理不干涉超时逻辑，由客户端自行设置
 	}
 
+	logger := log.New(os.Stderr, "[PROXY] ", log.LstdFlags)
+
+	routes, err := loadRoutes(config, logger)
+	if err != nil {
+		logger.Printf("Failed to load routes, falling back to default: %v", err)
+		routes = defaultRoutes(config.Target)
+	}
+
+	var certCache *mitm.CertCache
+	if config.CACertFile != "" && config.CAKeyFile != "" {
+		certCache, err = mitm.LoadCA(config.CACertFile, config.CAKeyFile)
+		if err != nil {
+			logger.Printf("Failed to load MITM CA, CONNECT interception disabled: %v", err)
+		}
+	}
+
+	var respCache respcache.Backend
+	if config.CacheTTL > 0 {
+		respCache = respcache.NewLRUCache(config.CacheMaxEntries)
+	}
+
 	return &Proxy{
-		config:     config,
-		httpClient: client,
-		logger:     log.New(os.Stderr, "[PROXY] ", log.LstdFlags),
+		config:         config,
+		httpClient:     client,
+		logger:         logger,
+		keyPool:        keypool.New(config.OpenAIKeys),
+		routes:         routes,
+		certCache:      certCache,
+		globalLimiter:  ratelimit.NewLimiter(config.RPS, config.Burst),
+		perKeyLimiters: ratelimit.NewKeyedLimiters(config.PerKeyRPS, config.Burst),
+		perIPSem:       ratelimit.NewSemaphore(config.PerIPConcurrency),
+		respCache:      respCache,
+	}
+}
+
+// loadRoutes builds the routing table from config.RoutesFile, or falls back
+// to the default routing table built from config.Target when no routes file
+// is configured.
+func loadRoutes(config Config, logger *log.Logger) (*router.Table, error) {
+	if config.RoutesFile == "" {
+		return defaultRoutes(config.Target), nil
 	}
+	return router.Load(config.RoutesFile)
+}
+
+// defaultRoutes reproduces the proxy's original behavior as a routing
+// table: strip the legacy Tencent Cloud "/release"/"/test" environment
+// prefixes, then forward everything else to target unchanged.
+func defaultRoutes(target string) *router.Table {
+	return router.NewTable([]router.Rule{
+		{Prefix: "/release", Upstream: target, StripPrefix: true},
+		{Prefix: "/test", Upstream: target, StripPrefix: true},
+		{Prefix: "", Upstream: target},
+	})
+}
+
+// watchRoutesReload reloads the routing table from config.RoutesFile each
+// time the process receives SIGHUP, matching the hot-reload pattern used by
+// other long-running gateways.
+func (p *Proxy) watchRoutesReload() {
+	if p.config.RoutesFile == "" {
+		return
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+
+	go func() {
+		for range sigCh {
+			if err := p.routes.Reload(p.config.RoutesFile); err != nil {
+				p.logger.Printf("Failed to reload routes: %v", err)
+				continue
+			}
+			p.logger.Printf("Reloaded routes from %s", p.config.RoutesFile)
+		}
+	}()
+}
+
+// limiterGCInterval is how often idle per-key rate limiters are swept out.
+const limiterGCInterval = 5 * time.Minute
+
+// limiterIdleTimeout is how long a per-key rate limiter can sit unused
+// before it is eligible for GC.
+const limiterIdleTimeout = 10 * time.Minute
+
+// gcIdleLimiters periodically removes per-key rate limiters that have gone
+// idle, so the map doesn't grow without bound as new keys/IPs show up.
+func (p *Proxy) gcIdleLimiters() {
+	ticker := time.NewTicker(limiterGCInterval)
+	go func() {
+		for range ticker.C {
+			if removed := p.perKeyLimiters.GC(limiterIdleTimeout); removed > 0 {
+				p.logger.Printf("Garbage collected %d idle rate limiters", removed)
+			}
+		}
+	}()
 }
 
 // Start starts the proxy server
 func (p *Proxy) Start() error {
 	p.logger.Printf("Starting proxy server on %s, targeting %s", p.config.Listen, p.config.Target)
 
+	p.watchRoutesReload()
+	p.gcIdleLimiters()
+
 	// 创建HTTP服务器
 	server := &http.Server{
 		Addr:    p.config.Listen,
@@ -77,16 +226,265 @@ func (p *Proxy) Start() error {
 
 // handleRequest handles incoming HTTP requests
 func (p *Proxy) handleRequest(w http.ResponseWriter, r *http.Request) {
+	// CONNECT请求走MITM拦截路径，而不是普通的转发逻辑
+	if r.Method == http.MethodConnect {
+		p.handleConnect(w, r)
+		return
+	}
+
+	// 调试接口，暴露key池的健康状态
+	if r.URL.Path == "/debug/keys" {
+		p.handleDebugKeys(w, r)
+		return
+	}
+
+	// 管理接口，运行时增删路由规则
+	if r.URL.Path == "/admin/routes" {
+		p.handleAdminRoutes(w, r)
+		return
+	}
+
+	// 管理接口，运行时调整限流参数
+	if r.URL.Path == "/admin/limits" {
+		p.handleAdminLimits(w, r)
+		return
+	}
+
+	// 限流与并发控制
+	release, allowed, retryAfter := p.checkRateLimits(r)
+	if !allowed {
+		if retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		}
+		http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+		return
+	}
+	defer release()
+
 	// 创建请求上下文
 	ctx := r.Context()
 
 	// 处理请求
 	if err := p.processRequest(ctx, w, r); err != nil {
+		if errors.Is(err, keypool.ErrExhausted) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(keyPoolExhaustedRetryAfter.Seconds())))
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
 		p.logger.Printf("Error processing request: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
 
+// keyPoolExhaustedRetryAfter is advertised to callers when every key in the
+// pool is on cooldown, matching the shortest per-key cooldown keypool sets
+// for a 5xx.
+const keyPoolExhaustedRetryAfter = 5 * time.Second
+
+// checkRateLimits enforces the global RPS limit, the per-key RPS limit (keyed
+// on the caller's Authorization header), and the per-IP concurrency cap, in
+// that order. When allowed is true, the caller must invoke release once it
+// is done handling the request.
+func (p *Proxy) checkRateLimits(r *http.Request) (release func(), allowed bool, retryAfter time.Duration) {
+	if !p.globalLimiter.Allow() {
+		return nil, false, p.globalLimiter.RetryAfter()
+	}
+
+	if key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); key != "" {
+		if !p.perKeyLimiters.Allow(key) {
+			return nil, false, time.Second
+		}
+	}
+
+	p.configMu.RLock()
+	sem := p.perIPSem
+	p.configMu.RUnlock()
+
+	release, ok := sem.Acquire(clientIP(r))
+	if !ok {
+		return nil, false, time.Second
+	}
+	return release, true, 0
+}
+
+// clientIP extracts the client's IP for concurrency accounting, preferring
+// X-Forwarded-For (set by an upstream load balancer) over RemoteAddr.
+func clientIP(r *http.Request) string {
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		return strings.TrimSpace(strings.Split(xff, ",")[0])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// adminLimitsRequest is the body accepted by POST /admin/limits.
+type adminLimitsRequest struct {
+	RPS              *float64 `json:"rps,omitempty"`
+	Burst            *int     `json:"burst,omitempty"`
+	PerKeyRPS        *float64 `json:"perKeyRps,omitempty"`
+	PerIPConcurrency *int     `json:"perIpConcurrency,omitempty"`
+}
+
+// adminLimitsResponse is returned by GET /admin/limits. It deliberately
+// surfaces only the limit fields rather than the whole Config, which also
+// holds the upstream key pool and the admin token itself.
+type adminLimitsResponse struct {
+	RPS              float64 `json:"rps"`
+	Burst            int     `json:"burst"`
+	PerKeyRPS        float64 `json:"perKeyRps"`
+	PerIPConcurrency int     `json:"perIpConcurrency"`
+}
+
+// handleAdminLimits lets operators inspect or adjust rate limits at runtime,
+// guarded by the same bearer token as /admin/routes. Changing
+// PerIPConcurrency replaces the per-IP semaphore for every IP, so requests
+// already in flight are not counted against the new cap.
+func (p *Proxy) handleAdminLimits(w http.ResponseWriter, r *http.Request) {
+	if !p.checkAdminAuth(w, r) {
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		cfg := p.getConfig()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(adminLimitsResponse{
+			RPS:              cfg.RPS,
+			Burst:            cfg.Burst,
+			PerKeyRPS:        cfg.PerKeyRPS,
+			PerIPConcurrency: cfg.PerIPConcurrency,
+		})
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req adminLimitsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	p.configMu.Lock()
+	defer p.configMu.Unlock()
+
+	if req.RPS != nil {
+		p.config.RPS = *req.RPS
+	}
+	if req.Burst != nil {
+		p.config.Burst = *req.Burst
+	}
+	p.globalLimiter.SetLimit(p.config.RPS, p.config.Burst)
+
+	if req.PerKeyRPS != nil {
+		p.config.PerKeyRPS = *req.PerKeyRPS
+	}
+	p.perKeyLimiters.SetLimit(p.config.PerKeyRPS, p.config.Burst)
+
+	if req.PerIPConcurrency != nil {
+		p.config.PerIPConcurrency = *req.PerIPConcurrency
+		p.perIPSem = ratelimit.NewSemaphore(p.config.PerIPConcurrency)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkAdminAuth reports whether r carries the configured admin bearer
+// token, writing the appropriate error response and returning false if the
+// admin endpoints are disabled (no AdminToken configured) or the token
+// doesn't match. The comparison runs in constant time to avoid leaking the
+// token through response-time side channels.
+func (p *Proxy) checkAdminAuth(w http.ResponseWriter, r *http.Request) bool {
+	if p.config.AdminToken == "" {
+		http.Error(w, "admin endpoint disabled", http.StatusForbidden)
+		return false
+	}
+	want := "Bearer " + p.config.AdminToken
+	got := r.Header.Get("Authorization")
+	if subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// handleConnect terminates a forward-proxy CONNECT tunnel with MITM TLS so
+// OPENAI_BASE_URL (or any SDK) can point at the proxy transparently. It
+// requires --ca-cert/--ca-key to have been configured; otherwise CONNECT is
+// rejected.
+func (p *Proxy) handleConnect(w http.ResponseWriter, r *http.Request) {
+	if p.certCache == nil {
+		http.Error(w, "MITM interception not configured", http.StatusNotImplemented)
+		return
+	}
+	if err := mitm.Intercept(w, r, p.certCache, http.HandlerFunc(p.handleRequest)); err != nil {
+		p.logger.Printf("Error handling CONNECT for %s: %v", r.Host, err)
+	}
+}
+
+// handleDebugKeys reports the health of each key in the pool as JSON.
+func (p *Proxy) handleDebugKeys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(p.keyPool.Statuses()); err != nil {
+		p.logger.Printf("Error encoding key status: %v", err)
+	}
+}
+
+// adminRoutesRequest is the body accepted by POST /admin/routes.
+type adminRoutesRequest struct {
+	Action string      `json:"action"` // "add" or "remove"
+	Rule   router.Rule `json:"rule,omitempty"`
+	Prefix string      `json:"prefix,omitempty"` // used by "remove"
+}
+
+// handleAdminRoutes lets operators add or remove routing rules at runtime,
+// guarded by a bearer token. The endpoint is disabled when no AdminToken is
+// configured.
+func (p *Proxy) handleAdminRoutes(w http.ResponseWriter, r *http.Request) {
+	if !p.checkAdminAuth(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p.routes.Rules())
+		return
+	}
+
+	var req adminRoutesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	switch req.Action {
+	case "add":
+		if req.Rule.Prefix == "" || req.Rule.Upstream == "" {
+			http.Error(w, "rule.prefix and rule.upstream are required", http.StatusBadRequest)
+			return
+		}
+		p.routes.Add(req.Rule)
+	case "remove":
+		if !p.routes.Remove(req.Prefix) {
+			http.Error(w, "no rule with that prefix", http.StatusNotFound)
+			return
+		}
+	default:
+		http.Error(w, `action must be "add" or "remove"`, http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // processRequest processes the incoming request and forwards it to the target
 func (p *Proxy) processRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	// 验证URL
@@ -100,13 +498,44 @@ func (p *Proxy) processRequest(ctx context.Context, w http.ResponseWriter, r *ht
 		return fmt.Errorf("failed to build target URL: %w", err)
 	}
 
+	cfg := p.getConfig()
+
 	// 本地环境打印代理请求URL
-	if p.config.LocalEnv {
+	if cfg.LocalEnv {
 		p.logger.Printf("Proxying request to: %s", targetURL)
 	}
 
+	// 仅在确有需要时才缓冲请求体（供缓存键计算和中间件改写共用），
+	// 否则直接流式转发，避免大请求体（如音频上传）被整体读入内存
+	var bodyBytes []byte
+	if p.needsBufferedBody(r) {
+		bodyBytes, err = middleware.BufferBody(r)
+		if err != nil {
+			return fmt.Errorf("failed to read request body: %w", err)
+		}
+	}
+
+	cacheKey, cacheable := p.cacheKeyFor(r, targetURL, bodyBytes)
+	if cacheable {
+		if entry, ok := p.respCache.Get(cacheKey); ok {
+			return p.serveCached(w, entry)
+		}
+	}
+
+	// 运行中间件链的Before钩子，允许插件改写请求体
+	if err := p.middlewares.Before(r); err != nil {
+		return fmt.Errorf("middleware rejected request: %w", err)
+	}
+
+	// 从key池中选择一个key，注入Authorization头
+	poolKey, ok := p.keyPool.Next()
+	if !ok && p.keyPool.Len() > 0 {
+		// 池中配置了key，但全部处于冷却期：宁可快速失败，也不要用无Authorization的请求打到上游
+		return keypool.ErrExhausted
+	}
+
 	// 创建代理请求
-	proxyReq, err := p.createProxyRequest(ctx, r, targetURL)
+	proxyReq, err := p.createProxyRequest(ctx, r, targetURL, poolKey)
 	if err != nil {
 		return fmt.Errorf("failed to create proxy request: %w", err)
 	}
@@ -118,23 +547,115 @@ func (p *Proxy) processRequest(ctx context.Context, w http.ResponseWriter, r *ht
 	}
 	defer resp.Body.Close()
 
+	// 记录该key的健康状态
+	if poolKey != "" {
+		p.keyPool.RecordResult(poolKey, resp.StatusCode, parseRetryAfter(resp.Header.Get("Retry-After")))
+	}
+
+	// 运行中间件链的After钩子
+	if err := p.middlewares.After(resp); err != nil {
+		return fmt.Errorf("middleware rejected response: %w", err)
+	}
+
+	if cacheable && resp.StatusCode == http.StatusOK {
+		return p.cacheAndServe(w, resp, cacheKey, cfg.CacheTTL)
+	}
+
 	// 处理响应
 	return p.handleResponse(w, resp)
 }
 
-// buildTargetURL builds the target URL for the proxy request
+// needsBufferedBody reports whether r's body must be read into memory before
+// forwarding: either a middleware is registered and may want to inspect or
+// rewrite it, or response caching is enabled and r's method+path could be
+// cacheable (the body is then needed to check for "stream":true).
+func (p *Proxy) needsBufferedBody(r *http.Request) bool {
+	if len(p.middlewares) > 0 {
+		return true
+	}
+	return p.respCache != nil && respcache.PathCacheable(r.Method, r.URL.Path)
+}
+
+// cacheKeyFor reports whether r is eligible for response caching and, if so,
+// computes its cache key. Caching is skipped entirely when no cache backend
+// is configured.
+func (p *Proxy) cacheKeyFor(r *http.Request, targetURL string, body []byte) (key string, cacheable bool) {
+	if p.respCache == nil || !respcache.IsCacheable(r.Method, r.URL.Path, body) {
+		return "", false
+	}
+
+	authScope := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	key, err := respcache.Key(r.Method, targetURL, body, authScope)
+	if err != nil {
+		p.logger.Printf("Failed to compute cache key: %v", err)
+		return "", false
+	}
+	return key, true
+}
+
+// serveCached replays a cached response to the client verbatim.
+func (p *Proxy) serveCached(w http.ResponseWriter, entry *respcache.Entry) error {
+	p.copyHeaders(w.Header(), entry.Header)
+	w.WriteHeader(entry.StatusCode)
+	_, err := w.Write(entry.Body)
+	return err
+}
+
+// cacheAndServe buffers resp's body, stores it in the cache, and then
+// serves it to the client. Non-streaming cacheable endpoints always return
+// a small JSON body, so buffering it in full is cheap.
+func (p *Proxy) cacheAndServe(w http.ResponseWriter, resp *http.Response, cacheKey string, ttl time.Duration) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response body: %w", err)
+	}
+
+	p.respCache.Set(cacheKey, &respcache.Entry{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Body:       body,
+	}, ttl)
+
+	p.copyHeaders(w.Header(), resp.Header)
+	w.WriteHeader(resp.StatusCode)
+	_, err = w.Write(body)
+	return err
+}
+
+// parseRetryAfter parses a Retry-After header value expressed in seconds.
+// A malformed or absent header yields zero, letting the caller fall back to
+// its own default cooldown.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// buildTargetURL builds the target URL for the proxy request by matching it
+// against the routing table.
 func (p *Proxy) buildTargetURL(r *http.Request) (string, error) {
-	// 去掉环境前缀（针对腾讯云，如果包含的话，目前只用到了test和release）
-	path := strings.Replace(r.URL.Path, "/release", "", 1)
-	path = strings.Replace(path, "/test", "", 1)
+	rule, path, ok := p.routes.Match(r.URL.Path)
+	if !ok {
+		return "", fmt.Errorf("no route matches path %q", r.URL.Path)
+	}
 
 	// 构建目标URL
-	// 优先级: X-Target-Host 头 > 配置的目标域名
+	// 优先级: X-Target-Host 头 > 显式路由规则匹配到的upstream > MITM拦截请求的真实CONNECT目标host > 默认catch-all规则
 	var targetURL string
-	if targetHost := r.Header.Get("X-Target-Host"); targetHost != "" {
-		targetURL = "https://" + targetHost + path
-	} else {
-		targetURL = p.config.Target + path
+	switch {
+	case r.Header.Get("X-Target-Host") != "":
+		targetURL = "https://" + r.Header.Get("X-Target-Host") + path
+	case rule.Prefix != "":
+		targetURL = rule.Upstream + path
+	case isMITMRequest(r):
+		targetURL = "https://" + r.Host + path
+	default:
+		targetURL = rule.Upstream + path
 	}
 
 	// 添加查询参数
@@ -145,8 +666,18 @@ func (p *Proxy) buildTargetURL(r *http.Request) (string, error) {
 	return targetURL, nil
 }
 
-// createProxyRequest creates a new HTTP request to be sent to the target
-func (p *Proxy) createProxyRequest(ctx context.Context, r *http.Request, targetURL string) (*http.Request, error) {
+// isMITMRequest reports whether r arrived over a connection terminated by
+// the MITM interception path (see mitm.Intercept), as opposed to the
+// proxy's plain HTTP listener. For such requests r.Host carries the real
+// upstream host the CONNECT client asked for.
+func isMITMRequest(r *http.Request) bool {
+	return r.TLS != nil
+}
+
+// createProxyRequest creates a new HTTP request to be sent to the target.
+// When poolKey is non-empty, it overrides the caller's Authorization header
+// with a key from the pool, so the frontend never needs its own key.
+func (p *Proxy) createProxyRequest(ctx context.Context, r *http.Request, targetURL, poolKey string) (*http.Request, error) {
 	// 创建新请求
 	proxyReq, err := http.NewRequestWithContext(ctx, r.Method, targetURL, r.Body)
 	if err != nil {
@@ -156,6 +687,11 @@ func (p *Proxy) createProxyRequest(ctx context.Context, r *http.Request, targetU
 	// 复制请求头
 	p.copyHeaders(proxyReq.Header, r.Header)
 
+	// 使用key池中的key覆盖Authorization头
+	if poolKey != "" {
+		proxyReq.Header.Set("Authorization", "Bearer "+poolKey)
+	}
+
 	return proxyReq, nil
 }
 
@@ -176,11 +712,71 @@ func (p *Proxy) handleResponse(w http.ResponseWriter, resp *http.Response) error
 	// 设置响应状态码
 	w.WriteHeader(resp.StatusCode)
 
-	// 流式传输响应体
+	// SSE响应按事件分帧传输，以便中间件能看到完整事件；其他响应按原始字节流传输
+	if isEventStream(resp.Header.Get("Content-Type")) {
+		return p.streamSSE(w, resp.Body)
+	}
 	return p.streamResponse(w, resp.Body)
 }
 
-// streamResponse streams the response body to the client
+// isEventStream reports whether a Content-Type header denotes an SSE
+// response (allowing for a trailing charset parameter).
+func isEventStream(contentType string) bool {
+	return strings.HasPrefix(strings.TrimSpace(contentType), "text/event-stream")
+}
+
+// streamSSE streams an SSE response to the client one event at a time,
+// flushing after each event and fanning it out to the middleware chain's
+// OnChunk hook so plugins can do things like per-request token accounting.
+func (p *Proxy) streamSSE(w http.ResponseWriter, body io.ReadCloser) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 4096), 1<<20)
+	scanner.Split(splitSSEEvents)
+
+	flusher, _ := w.(http.Flusher)
+	for scanner.Scan() {
+		event := scanner.Bytes()
+
+		p.middlewares.OnChunk(event)
+
+		if _, err := w.Write(event); err != nil {
+			return fmt.Errorf("error writing response: %w", err)
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading response body: %w", err)
+	}
+	return nil
+}
+
+// splitSSEEvents is a bufio.SplitFunc that frames on the blank line
+// separating SSE events, so each token passed to the caller is one whole
+// event including its trailing delimiter. The SSE spec permits either LF
+// ("\n\n") or CRLF ("\r\n\r\n") line endings, so both are recognized.
+func splitSSEEvents(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	crlf := bytes.Index(data, []byte("\r\n\r\n"))
+	lf := bytes.Index(data, []byte("\n\n"))
+
+	switch {
+	case crlf >= 0 && (lf < 0 || crlf <= lf):
+		return crlf + 4, data[:crlf+4], nil
+	case lf >= 0:
+		return lf + 2, data[:lf+2], nil
+	}
+
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	if atEOF {
+		return 0, nil, io.EOF
+	}
+	return 0, nil, nil
+}
+
+// streamResponse streams a non-SSE response body to the client as raw bytes.
 func (p *Proxy) streamResponse(w http.ResponseWriter, body io.ReadCloser) error {
 	// 创建缓冲区
 	buf := make([]byte, 1024)
@@ -229,8 +825,31 @@ func loadConfig() Config {
 		"The target domain to proxy.")
 	flag.StringVar(&config.Listen, "listen", envOr("OPENAI_PROXY_LISTEN", ":9000"),
 		"The proxy listen address.")
+	flag.StringVar(&config.RoutesFile, "routes", envOr("OPENAI_PROXY_ROUTES_FILE", ""),
+		"Path to a YAML or JSON routing table. When unset, a default route is built from -target.")
+	flag.StringVar(&config.AdminToken, "admin-token", envOr("OPENAI_PROXY_ADMIN_TOKEN", ""),
+		"Bearer token required by /admin/routes and /admin/limits. Leave unset to disable those endpoints.")
+	flag.StringVar(&config.CACertFile, "ca-cert", envOr("OPENAI_PROXY_CA_CERT", ""),
+		"Path to a root CA certificate, enabling MITM HTTPS interception of CONNECT requests.")
+	flag.StringVar(&config.CAKeyFile, "ca-key", envOr("OPENAI_PROXY_CA_KEY", ""),
+		"Path to the root CA's private key, required alongside -ca-cert.")
+	flag.Float64Var(&config.RPS, "rps", envOrFloat("OPENAI_PROXY_RPS", 0),
+		"Global requests-per-second limit. 0 disables global rate limiting.")
+	flag.IntVar(&config.Burst, "burst", envOrInt("OPENAI_PROXY_BURST", 10),
+		"Burst capacity for the global and per-key rate limiters.")
+	flag.Float64Var(&config.PerKeyRPS, "per-key-rps", envOrFloat("OPENAI_PROXY_PER_KEY_RPS", 0),
+		"Per-API-key requests-per-second limit. 0 disables per-key rate limiting.")
+	flag.IntVar(&config.PerIPConcurrency, "per-ip-concurrency", envOrInt("OPENAI_PROXY_PER_IP_CONCURRENCY", 0),
+		"Maximum concurrent in-flight requests per client IP. 0 disables the cap.")
+	flag.DurationVar(&config.CacheTTL, "cache-ttl", envOrDuration("OPENAI_PROXY_CACHE_TTL", 0),
+		"TTL for cached responses to idempotent endpoints (embeddings, moderations, models). 0 disables caching.")
+	flag.IntVar(&config.CacheMaxEntries, "cache-max-entries", envOrInt("OPENAI_PROXY_CACHE_MAX_ENTRIES", 1000),
+		"Maximum number of entries held by the in-memory response cache.")
 	flag.Parse()
 
+	// 加载key池配置，多个key以"|"分隔
+	config.OpenAIKeys = keypool.ParseKeys(os.Getenv("OPENAI_API_KEYS"))
+
 	return config
 }
 
@@ -242,6 +861,48 @@ func envOr(key, fallback string) string {
 	return fallback
 }
 
+// envOrFloat returns the environment variable parsed as a float64, or a
+// fallback value if unset or invalid.
+func envOrFloat(key string, fallback float64) float64 {
+	s, ok := os.LookupEnv(key)
+	if !ok || s == "" {
+		return fallback
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fallback
+	}
+	return v
+}
+
+// envOrInt returns the environment variable parsed as an int, or a fallback
+// value if unset or invalid.
+func envOrInt(key string, fallback int) int {
+	s, ok := os.LookupEnv(key)
+	if !ok || s == "" {
+		return fallback
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return fallback
+	}
+	return v
+}
+
+// envOrDuration returns the environment variable parsed with
+// time.ParseDuration, or a fallback value if unset or invalid.
+func envOrDuration(key string, fallback time.Duration) time.Duration {
+	s, ok := os.LookupEnv(key)
+	if !ok || s == "" {
+		return fallback
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fallback
+	}
+	return v
+}
+
 func main() {
 	// 加载配置
 	config := loadConfig()
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func TestSplitSSEEvents(t *testing.T) {
+	input := "event: message\ndata: {\"a\":1}\n\nevent: message\ndata: {\"a\":2}\n\n"
+
+	scanner := bufio.NewScanner(bytes.NewBufferString(input))
+	scanner.Split(splitSSEEvents)
+
+	var events []string
+	for scanner.Scan() {
+		events = append(events, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("scanner error: %v", err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2: %q", len(events), events)
+	}
+	if events[0] != "event: message\ndata: {\"a\":1}\n\n" {
+		t.Errorf("unexpected first event: %q", events[0])
+	}
+}
+
+func TestSplitSSEEventsCRLF(t *testing.T) {
+	input := "event: message\r\ndata: {\"a\":1}\r\n\r\nevent: message\r\ndata: {\"a\":2}\r\n\r\n"
+
+	scanner := bufio.NewScanner(bytes.NewBufferString(input))
+	scanner.Split(splitSSEEvents)
+
+	var events []string
+	for scanner.Scan() {
+		events = append(events, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("scanner error: %v", err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2: %q", len(events), events)
+	}
+	if events[0] != "event: message\r\ndata: {\"a\":1}\r\n\r\n" {
+		t.Errorf("unexpected first event: %q", events[0])
+	}
+}
+
+func TestSplitSSEEventsTrailingPartial(t *testing.T) {
+	input := "event: message\ndata: done\n\nincomplete-tail"
+
+	scanner := bufio.NewScanner(bytes.NewBufferString(input))
+	scanner.Split(splitSSEEvents)
+
+	var events []string
+	for scanner.Scan() {
+		events = append(events, scanner.Text())
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2 (including the unterminated tail): %q", len(events), events)
+	}
+	if events[1] != "incomplete-tail" {
+		t.Errorf("unexpected tail event: %q", events[1])
+	}
+}
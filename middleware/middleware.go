@@ -0,0 +1,71 @@
+// Package middleware lets plugins observe and rewrite proxied requests and
+// responses, including per-event access to streamed Server-Sent Events.
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+)
+
+// Middleware is implemented by plugins that want to inspect or rewrite
+// traffic flowing through the proxy. Before runs on the incoming request
+// prior to forwarding, After runs on the upstream response before it is
+// streamed to the client, and OnChunk runs once per SSE event when the
+// response is a text/event-stream.
+type Middleware interface {
+	Before(r *http.Request) error
+	After(resp *http.Response) error
+	OnChunk(event []byte)
+}
+
+// Chain runs a series of Middleware in order. A zero-value Chain is valid
+// and does nothing.
+type Chain []Middleware
+
+// Before runs every middleware's Before hook, stopping at the first error.
+func (c Chain) Before(r *http.Request) error {
+	for _, m := range c {
+		if err := m.Before(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// After runs every middleware's After hook, stopping at the first error.
+func (c Chain) After(resp *http.Response) error {
+	for _, m := range c {
+		if err := m.After(resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OnChunk fans a single SSE event out to every middleware in the chain.
+func (c Chain) OnChunk(event []byte) {
+	for _, m := range c {
+		m.OnChunk(event)
+	}
+}
+
+// BufferBody reads r.Body in full through a TeeReader so the original bytes
+// are preserved, resets r.Body to a fresh reader over those bytes, and
+// returns the bytes for a middleware to inspect. Call SetBody afterwards if
+// the middleware wants to forward a rewritten body instead.
+func BufferBody(r *http.Request) ([]byte, error) {
+	var buf bytes.Buffer
+	body, err := io.ReadAll(io.TeeReader(r.Body, &buf))
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(&buf)
+	return body, nil
+}
+
+// SetBody replaces r.Body and Content-Length with newBody.
+func SetBody(r *http.Request, newBody []byte) {
+	r.Body = io.NopCloser(bytes.NewReader(newBody))
+	r.ContentLength = int64(len(newBody))
+}
@@ -0,0 +1,224 @@
+// Package mitm implements HTTPS interception for forward-proxy mode: it
+// terminates the TLS connection from a CONNECT client using per-host leaf
+// certificates generated on the fly and signed by a configurable root CA,
+// so plain HTTP requests can then be handled (and inspected/rewritten by
+// the middleware chain) just like any other proxied request.
+package mitm
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// leafValidity is how long generated leaf certificates remain valid.
+const leafValidity = 365 * 24 * time.Hour
+
+// CertCache generates per-host TLS leaf certificates signed by a root CA and
+// caches them keyed by hostname, so repeated CONNECTs to the same host don't
+// pay the certificate generation cost again.
+type CertCache struct {
+	caCert *x509.Certificate
+	caKey  *rsa.PrivateKey
+	certs  sync.Map // host -> *tls.Certificate
+}
+
+// LoadCA loads a PEM-encoded CA certificate and RSA private key from disk,
+// as passed via --ca-cert/--ca-key.
+func LoadCA(certPath, keyPath string) (*CertCache, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA cert: %w", err)
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA key: %w", err)
+	}
+
+	caTLSCert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA key pair: %w", err)
+	}
+	caCert, err := x509.ParseCertificate(caTLSCert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+	caKey, ok := caTLSCert.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("CA key must be RSA")
+	}
+
+	return &CertCache{caCert: caCert, caKey: caKey}, nil
+}
+
+// Get returns a leaf certificate for host, generating and caching one if
+// none exists yet.
+func (c *CertCache) Get(host string) (*tls.Certificate, error) {
+	if v, ok := c.certs.Load(host); ok {
+		return v.(*tls.Certificate), nil
+	}
+
+	cert, err := c.generate(host)
+	if err != nil {
+		return nil, err
+	}
+
+	// 另一个goroutine可能已经生成并存入了同一host的证书，以先存入者为准
+	actual, _ := c.certs.LoadOrStore(host, cert)
+	return actual.(*tls.Certificate), nil
+}
+
+// generate creates a fresh leaf certificate for host, signed by the CA.
+func (c *CertCache) generate(host string) (*tls.Certificate, error) {
+	leafKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate leaf key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: host},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(leafValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, c.caCert, &leafKey.PublicKey, c.caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign leaf certificate: %w", err)
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{der, c.caCert.Raw},
+		PrivateKey:  leafKey,
+	}, nil
+}
+
+// Intercept hijacks a CONNECT request, completes the tunnel with a MITM TLS
+// handshake (picking a leaf certificate by SNI from certs), and serves the
+// decrypted HTTP traffic to next, so the rest of the proxy can inspect and
+// forward it like any other request.
+func Intercept(w http.ResponseWriter, r *http.Request, certs *CertCache, next http.Handler) error {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return fmt.Errorf("response writer does not support hijacking")
+	}
+	clientConn, _, err := hijacker.Hijack()
+	if err != nil {
+		return fmt.Errorf("failed to hijack connection: %w", err)
+	}
+
+	if _, err := clientConn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		clientConn.Close()
+		return fmt.Errorf("failed to write CONNECT response: %w", err)
+	}
+
+	fallbackHost := r.URL.Hostname()
+	if fallbackHost == "" {
+		fallbackHost, _, _ = net.SplitHostPort(r.Host)
+	}
+
+	tlsConn := tls.Server(clientConn, &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			host := hello.ServerName
+			if host == "" {
+				host = fallbackHost
+			}
+			return certs.Get(host)
+		},
+	})
+
+	if err := tlsConn.Handshake(); err != nil {
+		tlsConn.Close()
+		return fmt.Errorf("mitm TLS handshake failed: %w", err)
+	}
+
+	// http.Server only fills in r.TLS for a bare *tls.Conn, and the listener
+	// below wraps tlsConn, so set it here for the handler to see.
+	state := tlsConn.ConnectionState()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.TLS == nil {
+			req.TLS = &state
+		}
+		next.ServeHTTP(w, req)
+	})
+
+	server := &http.Server{Handler: handler}
+	return server.Serve(newSingleConnListener(tlsConn))
+}
+
+// singleConnListener is a net.Listener that yields exactly one already-
+// established connection, then blocks until that connection is closed
+// before returning an error, so http.Server.Serve returns once the MITM
+// session ends instead of looping forever waiting for new connections.
+type singleConnListener struct {
+	connCh   chan net.Conn
+	closedCh chan struct{}
+	once     sync.Once
+}
+
+func newSingleConnListener(conn net.Conn) *singleConnListener {
+	l := &singleConnListener{
+		connCh:   make(chan net.Conn, 1),
+		closedCh: make(chan struct{}),
+	}
+	l.connCh <- &notifyCloseConn{Conn: conn, notify: l.markClosed}
+	return l
+}
+
+func (l *singleConnListener) markClosed() {
+	l.once.Do(func() { close(l.closedCh) })
+}
+
+func (l *singleConnListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.connCh:
+		return conn, nil
+	case <-l.closedCh:
+		return nil, fmt.Errorf("mitm: connection closed")
+	}
+}
+
+func (l *singleConnListener) Close() error {
+	l.markClosed()
+	return nil
+}
+
+func (l *singleConnListener) Addr() net.Addr {
+	return &net.TCPAddr{}
+}
+
+// notifyCloseConn wraps a net.Conn to call notify once when Close is
+// called, so singleConnListener knows the MITM session has ended.
+type notifyCloseConn struct {
+	net.Conn
+	once   sync.Once
+	notify func()
+}
+
+func (c *notifyCloseConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.notify)
+	return err
+}
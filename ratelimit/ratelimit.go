@@ -0,0 +1,177 @@
+// Package ratelimit provides token-bucket request rate limiting and
+// per-client concurrency caps for the proxy: a global limiter, a keyed
+// limiter per API key, and a keyed concurrency semaphore per client IP.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Limiter wraps a single token bucket with the settings used to create it,
+// so RetryAfter can give callers a reasonable backoff hint.
+type Limiter struct {
+	mu      sync.RWMutex
+	rps     float64
+	burst   int
+	limiter *rate.Limiter
+}
+
+// NewLimiter creates a token bucket allowing rps requests per second with
+// the given burst. rps <= 0 disables limiting (Allow always succeeds).
+func NewLimiter(rps float64, burst int) *Limiter {
+	return &Limiter{
+		rps:     rps,
+		burst:   burst,
+		limiter: rate.NewLimiter(rate.Limit(rps), burst),
+	}
+}
+
+// Allow reports whether a request may proceed right now.
+func (l *Limiter) Allow() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.rps <= 0 {
+		return true
+	}
+	return l.limiter.Allow()
+}
+
+// RetryAfter returns a reasonable Retry-After duration for a rejected
+// request: the time it takes the bucket to refill by one token.
+func (l *Limiter) RetryAfter() time.Duration {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.rps <= 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / l.rps)
+}
+
+// SetLimit adjusts the bucket's rate and burst at runtime, e.g. from the
+// /admin/limits endpoint.
+func (l *Limiter) SetLimit(rps float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rps = rps
+	l.burst = burst
+	l.limiter.SetLimit(rate.Limit(rps))
+	l.limiter.SetBurst(burst)
+}
+
+// entry pairs a keyed limiter with the last time it was used, for GC.
+type entry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// KeyedLimiters hands out one token bucket per key (e.g. per API key, or
+// per client IP), garbage collecting buckets that have gone idle.
+type KeyedLimiters struct {
+	mu       sync.Mutex
+	limiters map[string]*entry
+	rps      float64
+	burst    int
+}
+
+// NewKeyedLimiters creates a per-key limiter factory using rps/burst for
+// every new key. rps <= 0 disables limiting.
+func NewKeyedLimiters(rps float64, burst int) *KeyedLimiters {
+	return &KeyedLimiters{
+		limiters: make(map[string]*entry),
+		rps:      rps,
+		burst:    burst,
+	}
+}
+
+// Allow reports whether a request for key may proceed right now, creating
+// that key's bucket on first use.
+func (k *KeyedLimiters) Allow(key string) bool {
+	k.mu.Lock()
+	if k.rps <= 0 {
+		k.mu.Unlock()
+		return true
+	}
+	e, ok := k.limiters[key]
+	if !ok {
+		e = &entry{limiter: rate.NewLimiter(rate.Limit(k.rps), k.burst)}
+		k.limiters[key] = e
+	}
+	e.lastSeen = time.Now()
+	limiter := e.limiter
+	k.mu.Unlock()
+
+	return limiter.Allow()
+}
+
+// SetLimit adjusts the rps/burst used for keys created from now on, and
+// updates every limiter that already exists.
+func (k *KeyedLimiters) SetLimit(rps float64, burst int) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.rps = rps
+	k.burst = burst
+	for _, e := range k.limiters {
+		e.limiter.SetLimit(rate.Limit(rps))
+		e.limiter.SetBurst(burst)
+	}
+}
+
+// GC removes limiters that haven't been used in idleAfter, returning how
+// many were removed. Call it periodically (e.g. from a time.Ticker) so the
+// map doesn't grow without bound under many distinct keys/IPs.
+func (k *KeyedLimiters) GC(idleAfter time.Duration) int {
+	cutoff := time.Now().Add(-idleAfter)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	removed := 0
+	for key, e := range k.limiters {
+		if e.lastSeen.Before(cutoff) {
+			delete(k.limiters, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Semaphore caps the number of concurrent in-flight requests per key (e.g.
+// per client IP).
+type Semaphore struct {
+	mu    sync.Mutex
+	inUse map[string]int
+	max   int
+}
+
+// NewSemaphore creates a concurrency cap of max in-flight requests per key.
+// max <= 0 disables the cap (Acquire always succeeds).
+func NewSemaphore(max int) *Semaphore {
+	return &Semaphore{inUse: make(map[string]int), max: max}
+}
+
+// Acquire reserves a concurrency slot for key. If it returns true, the
+// caller must call the returned release func exactly once when done.
+func (s *Semaphore) Acquire(key string) (release func(), ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.max <= 0 {
+		return func() {}, true
+	}
+	if s.inUse[key] >= s.max {
+		return nil, false
+	}
+	s.inUse[key]++
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.inUse[key]--
+		if s.inUse[key] <= 0 {
+			delete(s.inUse, key)
+		}
+	}, true
+}
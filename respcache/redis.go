@@ -0,0 +1,46 @@
+package respcache
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisBackend is an optional Backend for operators who want cached
+// responses shared across multiple proxy instances instead of kept
+// in-memory per process.
+type RedisBackend struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisBackend wraps an existing Redis client. Keys are stored under
+// prefix+key so the cache can share a Redis instance with other data.
+func NewRedisBackend(client *redis.Client, prefix string) *RedisBackend {
+	return &RedisBackend{client: client, prefix: prefix}
+}
+
+// Get looks up key in Redis, returning false on a miss or any error.
+func (r *RedisBackend) Get(key string) (*Entry, bool) {
+	data, err := r.client.Get(context.Background(), r.prefix+key).Bytes()
+	if err != nil {
+		return nil, false
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false
+	}
+	return &entry, true
+}
+
+// Set stores entry in Redis under key with the given TTL.
+func (r *RedisBackend) Set(key string, entry *Entry, ttl time.Duration) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	r.client.Set(context.Background(), r.prefix+key, data, ttl)
+}
@@ -0,0 +1,176 @@
+// Package respcache caches proxy responses for idempotent, non-streaming
+// endpoints (embeddings, moderations, listing models) so repeated identical
+// requests skip the upstream call entirely.
+package respcache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Entry is a cached response: just enough to replay it verbatim.
+type Entry struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Backend stores cached Entries, keyed by an opaque cache key from Key.
+// Implementations must be safe for concurrent use.
+type Backend interface {
+	Get(key string) (*Entry, bool)
+	Set(key string, entry *Entry, ttl time.Duration)
+}
+
+// cacheablePaths maps a method+path to whether requests against it may be
+// cached at all. GET /v1/models ignores the request body; the POST
+// endpoints are checked further for stream:true.
+var cacheablePaths = map[string]map[string]bool{
+	http.MethodGet:  {"/v1/models": true},
+	http.MethodPost: {"/v1/embeddings": true, "/v1/moderations": true},
+}
+
+// PathCacheable reports whether method+path is on the cacheable allow-list,
+// without inspecting the request body. Callers can use this to decide
+// whether buffering the body (to check for stream:true) is worth doing at
+// all before IsCacheable runs the full check.
+func PathCacheable(method, path string) bool {
+	return cacheablePaths[method][path]
+}
+
+// IsCacheable reports whether a request is eligible for caching: its
+// method+path is on the allow-list, and (for POSTs) its body doesn't ask
+// for streaming.
+func IsCacheable(method, path string, body []byte) bool {
+	if !PathCacheable(method, path) {
+		return false
+	}
+	if method != http.MethodPost {
+		return true
+	}
+	return !wantsStream(body)
+}
+
+// wantsStream reports whether a JSON request body sets "stream": true.
+// A body that fails to parse is treated as not streaming, since it will
+// fail upstream anyway and isn't worth blocking the cache path over.
+func wantsStream(body []byte) bool {
+	if len(body) == 0 {
+		return false
+	}
+	var probe struct {
+		Stream bool `json:"stream"`
+	}
+	if err := json.Unmarshal(body, &probe); err != nil {
+		return false
+	}
+	return probe.Stream
+}
+
+// Key builds a cache key from (method, target URL, sorted request body
+// hash, auth scope). The body is canonicalized (decoded and re-encoded)
+// before hashing so two requests that differ only in JSON key order still
+// hit the same cache entry.
+func Key(method, targetURL string, body []byte, authScope string) (string, error) {
+	canonicalBody, err := canonicalizeJSON(body)
+	if err != nil {
+		return "", fmt.Errorf("failed to canonicalize request body: %w", err)
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n", method, targetURL, authScope)
+	h.Write(canonicalBody)
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// canonicalizeJSON decodes and re-encodes a JSON body; encoding/json always
+// emits object keys in sorted order, which is what gives us a
+// order-independent hash.
+func canonicalizeJSON(body []byte) ([]byte, error) {
+	if len(body) == 0 {
+		return body, nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// cacheItem is the value stored in LRUCache's linked list.
+type cacheItem struct {
+	key       string
+	entry     *Entry
+	expiresAt time.Time
+}
+
+// LRUCache is the default in-memory Backend: an LRU with a max entry count
+// and a per-entry TTL.
+type LRUCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	ll         *list.List
+	items      map[string]*list.Element
+}
+
+// NewLRUCache creates an in-memory cache holding at most maxEntries items.
+// maxEntries <= 0 means unbounded.
+func NewLRUCache(maxEntries int) *LRUCache {
+	return &LRUCache{
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// Get returns the cached entry for key, if present and not expired.
+func (c *LRUCache) Get(key string) (*Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	item := elem.Value.(*cacheItem)
+	if time.Now().After(item.expiresAt) {
+		c.removeElement(elem)
+		return nil, false
+	}
+
+	c.ll.MoveToFront(elem)
+	return item.entry, true
+}
+
+// Set stores entry under key with the given TTL, evicting the least
+// recently used entry if the cache is over capacity.
+func (c *LRUCache) Set(key string, entry *Entry, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := time.Now().Add(ttl)
+	if elem, ok := c.items[key]; ok {
+		c.ll.MoveToFront(elem)
+		item := elem.Value.(*cacheItem)
+		item.entry = entry
+		item.expiresAt = expiresAt
+		return
+	}
+
+	elem := c.ll.PushFront(&cacheItem{key: key, entry: entry, expiresAt: expiresAt})
+	c.items[key] = elem
+
+	if c.maxEntries > 0 && c.ll.Len() > c.maxEntries {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+func (c *LRUCache) removeElement(elem *list.Element) {
+	c.ll.Remove(elem)
+	delete(c.items, elem.Value.(*cacheItem).key)
+}
@@ -0,0 +1,63 @@
+package respcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUCacheEviction(t *testing.T) {
+	c := NewLRUCache(2)
+
+	c.Set("a", &Entry{StatusCode: 200}, time.Minute)
+	c.Set("b", &Entry{StatusCode: 200}, time.Minute)
+
+	// Touch "a" so "b" becomes the least recently used entry.
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("expected a to be cached")
+	}
+
+	c.Set("c", &Entry{StatusCode: 200}, time.Minute)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("expected b to be evicted as least recently used")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("expected a to survive eviction")
+	}
+	if _, ok := c.Get("c"); !ok {
+		t.Error("expected c to be cached")
+	}
+}
+
+func TestLRUCacheExpiry(t *testing.T) {
+	c := NewLRUCache(0)
+
+	c.Set("a", &Entry{StatusCode: 200}, -time.Second)
+
+	if _, ok := c.Get("a"); ok {
+		t.Error("expected expired entry to be evicted on Get")
+	}
+}
+
+func TestIsCacheable(t *testing.T) {
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		body   []byte
+		want   bool
+	}{
+		{"models GET", "GET", "/v1/models", nil, true},
+		{"embeddings POST", "POST", "/v1/embeddings", []byte(`{"input":"hi"}`), true},
+		{"chat completions not cacheable", "POST", "/v1/chat/completions", nil, false},
+		{"streaming embeddings bypasses cache", "POST", "/v1/embeddings", []byte(`{"stream":true}`), false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := IsCacheable(tc.method, tc.path, tc.body); got != tc.want {
+				t.Errorf("IsCacheable(%q, %q, %s) = %v, want %v", tc.method, tc.path, tc.body, got, tc.want)
+			}
+		})
+	}
+}
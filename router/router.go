@@ -0,0 +1,195 @@
+// Package router implements a path-prefix routing table that maps incoming
+// request paths to upstream targets, so a single proxy binary can front
+// several distinct APIs (OpenAI, Anthropic, Azure OpenAI, a self-hosted
+// vLLM endpoint, ...) on different path prefixes.
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rule describes how requests under Prefix are forwarded.
+type Rule struct {
+	// Prefix is the path prefix this rule matches, e.g. "/openai".
+	Prefix string `json:"prefix" yaml:"prefix"`
+	// Upstream is the scheme+host (and optional base path) to forward to.
+	Upstream string `json:"upstream" yaml:"upstream"`
+	// RewritePrefix, if set, replaces Prefix in the forwarded path instead
+	// of simply stripping it.
+	RewritePrefix string `json:"rewritePrefix,omitempty" yaml:"rewritePrefix,omitempty"`
+	// StripPrefix removes Prefix from the forwarded path when true and
+	// RewritePrefix is empty.
+	StripPrefix bool `json:"stripPrefix,omitempty" yaml:"stripPrefix,omitempty"`
+}
+
+// rulesFile is the on-disk shape for both the YAML and JSON route files.
+type rulesFile struct {
+	Routes []Rule `json:"routes" yaml:"routes"`
+}
+
+// Table is a set of routing rules, matched longest-prefix-first. It is safe
+// for concurrent use.
+type Table struct {
+	mu    sync.RWMutex
+	rules []Rule
+}
+
+// NewTable builds a Table from an initial rule set.
+func NewTable(rules []Rule) *Table {
+	t := &Table{}
+	t.set(rules)
+	return t
+}
+
+// Load reads a routing table from a YAML or JSON file, chosen by extension
+// (.yaml/.yml vs .json).
+func Load(path string) (*Table, error) {
+	t := &Table{}
+	if err := t.Reload(path); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Reload re-reads the routing table from path and atomically replaces the
+// rule set. It is intended to be called from a SIGHUP handler or fsnotify
+// watcher.
+func (t *Table) Reload(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read routes file: %w", err)
+	}
+
+	var rf rulesFile
+	switch ext := strings.ToLower(pathExt(path)); ext {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &rf); err != nil {
+			return fmt.Errorf("failed to parse routes YAML: %w", err)
+		}
+	case ".json":
+		if err := json.Unmarshal(data, &rf); err != nil {
+			return fmt.Errorf("failed to parse routes JSON: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported routes file extension: %s", ext)
+	}
+
+	t.set(rf.Routes)
+	return nil
+}
+
+func pathExt(path string) string {
+	if i := strings.LastIndexByte(path, '.'); i >= 0 {
+		return path[i:]
+	}
+	return ""
+}
+
+// set replaces the rule set, sorting by prefix length descending so Match
+// can return on the first hit.
+func (t *Table) set(rules []Rule) {
+	sorted := make([]Rule, len(rules))
+	copy(sorted, rules)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i].Prefix) > len(sorted[j].Prefix)
+	})
+
+	t.mu.Lock()
+	t.rules = sorted
+	t.mu.Unlock()
+}
+
+// Match returns the longest-prefix rule matching path, and the remainder of
+// the path after applying the rule's rewrite/strip behavior.
+func (t *Table) Match(path string) (rule Rule, rewrittenPath string, ok bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	for _, r := range t.rules {
+		if !prefixMatches(path, r.Prefix) {
+			continue
+		}
+		return r, rewritePath(r, path), true
+	}
+	return Rule{}, "", false
+}
+
+// prefixMatches reports whether path is under prefix, treating prefix as a
+// path segment boundary so a rule for "/release" matches "/release" and
+// "/release/v1" but not "/releases".
+func prefixMatches(path, prefix string) bool {
+	if prefix == "" {
+		return true
+	}
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	rest := path[len(prefix):]
+	return rest == "" || rest[0] == '/'
+}
+
+func rewritePath(r Rule, path string) string {
+	suffix := strings.TrimPrefix(path, r.Prefix)
+	switch {
+	case r.RewritePrefix != "":
+		return r.RewritePrefix + suffix
+	case r.StripPrefix:
+		return suffix
+	default:
+		return path
+	}
+}
+
+// Rules returns a copy of the current rule set, in match order.
+func (t *Table) Rules() []Rule {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	out := make([]Rule, len(t.rules))
+	copy(out, t.rules)
+	return out
+}
+
+// Add inserts or replaces the rule for a given prefix.
+func (t *Table) Add(rule Rule) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, r := range t.rules {
+		if r.Prefix == rule.Prefix {
+			t.rules[i] = rule
+			t.resort()
+			return
+		}
+	}
+	t.rules = append(t.rules, rule)
+	t.resort()
+}
+
+// Remove deletes the rule for a given prefix, reporting whether one existed.
+func (t *Table) Remove(prefix string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, r := range t.rules {
+		if r.Prefix == prefix {
+			t.rules = append(t.rules[:i], t.rules[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// resort re-sorts rules by prefix length descending. Callers must hold t.mu.
+func (t *Table) resort() {
+	sort.SliceStable(t.rules, func(i, j int) bool {
+		return len(t.rules[i].Prefix) > len(t.rules[j].Prefix)
+	})
+}
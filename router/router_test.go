@@ -0,0 +1,56 @@
+package router
+
+import "testing"
+
+func TestTableMatch(t *testing.T) {
+	table := NewTable([]Rule{
+		{Prefix: "/release", Upstream: "https://release.example.com", StripPrefix: true},
+		{Prefix: "/openai", Upstream: "https://api.openai.com", RewritePrefix: "/v1"},
+		{Prefix: "", Upstream: "https://default.example.com"},
+	})
+
+	cases := []struct {
+		name         string
+		path         string
+		wantUpstream string
+		wantPath     string
+		wantOK       bool
+	}{
+		{"exact prefix match", "/release", "https://release.example.com", "", true},
+		{"prefix with trailing segment", "/release/v1/chat", "https://release.example.com", "/v1/chat", true},
+		{"prefix must stop at segment boundary", "/releases/v1/chat", "https://default.example.com", "/releases/v1/chat", true},
+		{"rewrite prefix", "/openai/chat/completions", "https://api.openai.com", "/v1/chat/completions", true},
+		{"falls through to catch-all", "/anything", "https://default.example.com", "/anything", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rule, rewritten, ok := table.Match(tc.path)
+			if ok != tc.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tc.wantOK)
+			}
+			if rule.Upstream != tc.wantUpstream {
+				t.Errorf("upstream = %q, want %q", rule.Upstream, tc.wantUpstream)
+			}
+			if rewritten != tc.wantPath {
+				t.Errorf("rewritten path = %q, want %q", rewritten, tc.wantPath)
+			}
+		})
+	}
+}
+
+func TestTableAddRemove(t *testing.T) {
+	table := NewTable(nil)
+
+	table.Add(Rule{Prefix: "/a", Upstream: "https://a.example.com"})
+	if _, _, ok := table.Match("/a/x"); !ok {
+		t.Fatal("expected /a/x to match after Add")
+	}
+
+	if !table.Remove("/a") {
+		t.Fatal("Remove reported no rule removed")
+	}
+	if _, _, ok := table.Match("/a/x"); ok {
+		t.Fatal("expected /a/x to no longer match after Remove")
+	}
+}